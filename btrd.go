@@ -8,7 +8,6 @@ import (
 	"time"
 
 	"github.com/Knetic/govaluate"
-	"github.com/tarm/serial"
 )
 
 // ADC is Analog to Digital Converter item.
@@ -18,39 +17,146 @@ import (
 // from ADC and vref will be replaced with ADC.Vref.
 // For example, ADC.Expr = "ADCval * (vref / 256)"
 // Cmdget is communication comand for getting the measurement result from ADC.
+// Fc and Regaddr select the Modbus function code (0x03/0x04) and register
+// address to read when the owning Btdev's transport is "modbus-rtu"; the
+// 16-bit register value is then fed into Expr as "regval" instead of
+// ADCval/adcval.
+// Driver selects a native I2C chip driver ("ads1115") when the owning
+// Btdev is backed by an I2CBus; Addr is the chip's I2C slave address and
+// Reg is driver-specific (for ads1115, the pre-built 16-bit config
+// register value selecting input/gain/rate, written via WriteWordToReg).
+// IntervalMs is how often, in milliseconds, the poll scheduler reads this
+// ADC (0 uses DefaultADCIntervalMs). Deadband suppresses notifications
+// (ShouldNotify) for readings that haven't moved by more than this much
+// since the last one. HistSize and HistRetentionSec size the in-memory
+// sample history returned by History and exposed over the /history
+// endpoint (0 uses defaultHistSize and keeps no retention cutoff).
 type ADC struct {
-	ID     string  `toml:"id"`
-	Vref   float64 `toml:"vref"`
-	Cmdget string  `toml:"cmdget"`
-	Expr   string  `toml:"expr"`
+	ID               string  `toml:"id"`
+	Vref             float64 `toml:"vref"`
+	Cmdget           string  `toml:"cmdget"`
+	Expr             string  `toml:"expr"`
+	Fc               byte    `toml:"fc"`
+	Regaddr          uint16  `toml:"regaddr"`
+	Driver           string  `toml:"driver"`
+	Addr             byte    `toml:"addr"`
+	Reg              uint16  `toml:"reg"`
+	IntervalMs       int     `toml:"interval_ms"`
+	Deadband         float64 `toml:"deadband"`
+	HistSize         int     `toml:"hist_size"`
+	HistRetentionSec int     `toml:"hist_retention_sec"`
 	*Btdev
-	valmux sync.RWMutex
-	value  float64
+	valmux     sync.RWMutex
+	value      float64
+	notified   bool
+	lastNotify float64
+	hist       *History
 }
 
 // Tmpt is temperature sensor item (ds18b20 sensor)
 // Cmdlsb and Cmdmsb are communication comands for getting the least significant bits (LSB)
 // and most significant bits (MSB) of result from sensor.
+// Regaddr is the Modbus holding register address to read when the owning
+// Btdev's transport is "modbus-rtu". If Regcount is 2, two consecutive
+// registers (LSB, MSB) are read and combined as with the raw protocol;
+// otherwise a single signed 16-bit register is read, in 0.1 degC units.
+// Driver selects a native I2C chip driver ("tmp006" or "lm75") when the
+// owning Btdev is backed by an I2CBus; Addr is the chip's I2C slave
+// address and Reg is the chip's temperature register.
+// IntervalMs is how often, in milliseconds, the poll scheduler reads this
+// Tmpt (0 uses DefaultTmptIntervalMs; DS18B20-style sensors are slow to
+// convert and should use a longer interval). Deadband suppresses
+// notifications (ShouldNotify) for readings that haven't moved by more
+// than this much since the last one. HistSize and HistRetentionSec size
+// the in-memory sample history returned by History and exposed over the
+// /history endpoint (0 uses defaultHistSize and keeps no retention
+// cutoff).
 type Tmpt struct {
-	ID     string `toml:"id"`
-	Cmdlsb string `toml:"cmdlsb"`
-	Cmdmsb string `toml:"cmdmsb"`
+	ID               string  `toml:"id"`
+	Cmdlsb           string  `toml:"cmdlsb"`
+	Cmdmsb           string  `toml:"cmdmsb"`
+	Regaddr          uint16  `toml:"regaddr"`
+	Regcount         int     `toml:"regcount"`
+	Driver           string  `toml:"driver"`
+	Addr             byte    `toml:"addr"`
+	Reg              byte    `toml:"reg"`
+	IntervalMs       int     `toml:"interval_ms"`
+	Deadband         float64 `toml:"deadband"`
+	HistSize         int     `toml:"hist_size"`
+	HistRetentionSec int     `toml:"hist_retention_sec"`
 	*Btdev
-	valmux sync.RWMutex
-	value  float64
+	valmux     sync.RWMutex
+	value      float64
+	notified   bool
+	lastNotify float64
+	hist       *History
 }
 
 // Swt is two-state switch item.
 // Cmdget and Cmdset are communication comands for getting and setting state of switch.
 // Cmdclr is communication comand for clearing state of switch.
+// Coiladdr is the Modbus coil address used for ReadValue/SetBit/ClearBit
+// when the owning Btdev's transport is "modbus-rtu".
+// Driver selects a native I2C chip driver ("mcp23017") when the owning
+// Btdev is backed by an I2CBus; Addr is the chip's I2C slave address and
+// Reg is the GPIO pin number (0-7) on its port A.
+// IntervalMs is how often, in milliseconds, the poll scheduler reads this
+// Swt (0 uses DefaultSwtIntervalMs). HistSize and HistRetentionSec size
+// the in-memory sample history returned by History and exposed over the
+// /history endpoint (0 uses defaultHistSize and keeps no retention
+// cutoff).
 type Swt struct {
-	ID     string `toml:"id"`
-	Cmdget string `toml:"cmdget"`
-	Cmdset string `toml:"cmdset"`
-	Cmdclr string `toml:"cmdclr"`
+	ID               string `toml:"id"`
+	Cmdget           string `toml:"cmdget"`
+	Cmdset           string `toml:"cmdset"`
+	Cmdclr           string `toml:"cmdclr"`
+	Coiladdr         uint16 `toml:"coiladdr"`
+	Driver           string `toml:"driver"`
+	Addr             byte   `toml:"addr"`
+	Reg              byte   `toml:"reg"`
+	IntervalMs       int    `toml:"interval_ms"`
+	HistSize         int    `toml:"hist_size"`
+	HistRetentionSec int    `toml:"hist_retention_sec"`
 	*Btdev
 	valmux sync.RWMutex
 	value  int
+	hist   *History
+}
+
+// Default poll intervals used by the scheduler when an item's
+// IntervalMs is 0: ADCs are cheap and fast, Tmpts (e.g. DS18B20-style
+// sensors) are slow to convert, and Swts change rarely.
+const (
+	DefaultADCIntervalMs  = 500
+	DefaultTmptIntervalMs = 5000
+	DefaultSwtIntervalMs  = 2000
+)
+
+// Interval returns how often the scheduler should poll a, falling back
+// to DefaultADCIntervalMs.
+func (a *ADC) Interval() time.Duration {
+	if a.IntervalMs <= 0 {
+		return DefaultADCIntervalMs * time.Millisecond
+	}
+	return time.Duration(a.IntervalMs) * time.Millisecond
+}
+
+// Interval returns how often the scheduler should poll t, falling back
+// to DefaultTmptIntervalMs.
+func (t *Tmpt) Interval() time.Duration {
+	if t.IntervalMs <= 0 {
+		return DefaultTmptIntervalMs * time.Millisecond
+	}
+	return time.Duration(t.IntervalMs) * time.Millisecond
+}
+
+// Interval returns how often the scheduler should poll sw, falling back
+// to DefaultSwtIntervalMs.
+func (sw *Swt) Interval() time.Duration {
+	if sw.IntervalMs <= 0 {
+		return DefaultSwtIntervalMs * time.Millisecond
+	}
+	return time.Duration(sw.IntervalMs) * time.Millisecond
 }
 
 // Value method for getting ADC result
@@ -74,6 +180,90 @@ func (sw *Swt) Value() int {
 	return sw.value
 }
 
+// ShouldNotify reports whether the most recent ReadValue result differs
+// from the last notified value by more than Deadband, and if so records
+// it as the new baseline. The first reading always notifies. It is meant
+// to gate downstream notifications (MQTT, Prometheus) so readings that
+// haven't moved don't spam them.
+func (a *ADC) ShouldNotify() bool {
+	a.valmux.Lock()
+	defer a.valmux.Unlock()
+	if !a.notified || math.Abs(a.value-a.lastNotify) > a.Deadband {
+		a.notified = true
+		a.lastNotify = a.value
+		return true
+	}
+	return false
+}
+
+// ShouldNotify reports whether the most recent ReadValue result differs
+// from the last notified value by more than Deadband, and if so records
+// it as the new baseline. The first reading always notifies.
+func (t *Tmpt) ShouldNotify() bool {
+	t.valmux.Lock()
+	defer t.valmux.Unlock()
+	if !t.notified || math.Abs(t.value-t.lastNotify) > t.Deadband {
+		t.notified = true
+		t.lastNotify = t.value
+		return true
+	}
+	return false
+}
+
+// Init prepares a's history ring buffer, sized from HistSize/
+// HistRetentionSec (both default if zero/unset). It must be called once
+// after a is decoded from TOML and before its Btdev starts polling.
+func (a *ADC) Init() {
+	a.hist = NewHistory(a.HistSize, time.Duration(a.HistRetentionSec)*time.Second)
+}
+
+// History returns a's sample history.
+func (a *ADC) History() *History {
+	return a.hist
+}
+
+// Subscribe returns a channel that receives values appended to a's
+// history from this call onward (see History.Subscribe).
+func (a *ADC) Subscribe() <-chan Sample {
+	return a.hist.Subscribe()
+}
+
+// Init prepares t's history ring buffer, sized from HistSize/
+// HistRetentionSec (both default if zero/unset). It must be called once
+// after t is decoded from TOML and before its Btdev starts polling.
+func (t *Tmpt) Init() {
+	t.hist = NewHistory(t.HistSize, time.Duration(t.HistRetentionSec)*time.Second)
+}
+
+// History returns t's sample history.
+func (t *Tmpt) History() *History {
+	return t.hist
+}
+
+// Subscribe returns a channel that receives values appended to t's
+// history from this call onward (see History.Subscribe).
+func (t *Tmpt) Subscribe() <-chan Sample {
+	return t.hist.Subscribe()
+}
+
+// Init prepares sw's history ring buffer, sized from HistSize/
+// HistRetentionSec (both default if zero/unset). It must be called once
+// after sw is decoded from TOML and before its Btdev starts polling.
+func (sw *Swt) Init() {
+	sw.hist = NewHistory(sw.HistSize, time.Duration(sw.HistRetentionSec)*time.Second)
+}
+
+// History returns sw's sample history.
+func (sw *Swt) History() *History {
+	return sw.hist
+}
+
+// Subscribe returns a channel that receives values appended to sw's
+// history from this call onward (see History.Subscribe).
+func (sw *Swt) Subscribe() <-chan Sample {
+	return sw.hist.Subscribe()
+}
+
 func getFloat(unkn interface{}) (float64, error) {
 	switch i := unkn.(type) {
 	case float64:
@@ -103,15 +293,6 @@ func ConvertTemp(msb byte, lsb byte) float64 {
 func (a *ADC) ReadValue() error {
 	a.sermux.Lock()
 	defer a.sermux.Unlock()
-	if _, err := a.serport.Write([]byte(a.Cmdget)); err != nil {
-		err = fmt.Errorf("Serial port %s write error: %s", a.Devfile, err)
-		return err
-	}
-	val := make([]byte, 1)
-	if _, err := a.serport.Read(val); err != nil {
-		err = fmt.Errorf("Serial port %s read error: %s", a.Devfile, err)
-		return err
-	}
 
 	expr, err := govaluate.NewEvaluableExpression(a.Expr)
 	if err != nil {
@@ -119,8 +300,30 @@ func (a *ADC) ReadValue() error {
 		return err
 	}
 	parameters := make(map[string]interface{}, 8)
-	parameters["adcval"] = float64(val[0])
 	parameters["vref"] = float64(a.Vref)
+
+	if a.Driver == driverADS1115 {
+		regval, err := readADS1115(a.bus, a.Addr, a.Reg)
+		if err != nil {
+			return fmt.Errorf("I2C device %s read error: %s", a.Devfile, err)
+		}
+		parameters["regval"] = float64(regval)
+	} else if a.TransportName == transportModbusRTU {
+		regval, err := a.transport.ReadRegister(a.SlaveID, a.Fc, a.Regaddr)
+		if err != nil {
+			err = fmt.Errorf("Modbus device %s read error: %s", a.Devfile, err)
+			return err
+		}
+		parameters["regval"] = float64(regval)
+	} else {
+		val, err := a.transport.Raw(a.Cmdget)
+		if err != nil {
+			err = fmt.Errorf("Serial port %s read error: %s", a.Devfile, err)
+			return err
+		}
+		parameters["adcval"] = float64(val)
+	}
+
 	result, err := expr.Evaluate(parameters)
 	if err != nil {
 		err = fmt.Errorf("Expression parsing error: %s", err)
@@ -132,6 +335,7 @@ func (a *ADC) ReadValue() error {
 	if err != nil {
 		return err
 	}
+	a.hist.Append(time.Now(), a.value)
 	return nil
 }
 
@@ -139,27 +343,64 @@ func (a *ADC) ReadValue() error {
 func (t *Tmpt) ReadValue() error {
 	t.sermux.Lock()
 	defer t.sermux.Unlock()
-	if _, err := t.serport.Write([]byte(t.Cmdlsb)); err != nil {
-		err = fmt.Errorf("Serial port %s write error: %s", t.Devfile, err)
-		return err
+
+	if t.Driver == driverTMP006 || t.Driver == driverLM75 {
+		var temp float64
+		var err error
+		if t.Driver == driverTMP006 {
+			temp, err = readTMP006(t.bus, t.Addr, t.Reg)
+		} else {
+			temp, err = readLM75(t.bus, t.Addr, t.Reg)
+		}
+		if err != nil {
+			return fmt.Errorf("I2C device %s read error: %s", t.Devfile, err)
+		}
+		t.valmux.Lock()
+		defer t.valmux.Unlock()
+		t.value = temp
+		t.hist.Append(time.Now(), t.value)
+		return nil
 	}
-	lsb := make([]byte, 1)
-	if _, err := t.serport.Read(lsb); err != nil {
-		err = fmt.Errorf("Serial port %s read error: %s", t.Devfile, err)
-		return err
+
+	if t.TransportName == transportModbusRTU {
+		if t.Regcount == 2 {
+			lsb, err := t.transport.ReadRegister(t.SlaveID, fcReadHoldingRegisters, t.Regaddr)
+			if err != nil {
+				return fmt.Errorf("Modbus device %s read error: %s", t.Devfile, err)
+			}
+			msb, err := t.transport.ReadRegister(t.SlaveID, fcReadHoldingRegisters, t.Regaddr+1)
+			if err != nil {
+				return fmt.Errorf("Modbus device %s read error: %s", t.Devfile, err)
+			}
+			t.valmux.Lock()
+			defer t.valmux.Unlock()
+			t.value = ConvertTemp(byte(msb), byte(lsb))
+			t.hist.Append(time.Now(), t.value)
+			return nil
+		}
+		regval, err := t.transport.ReadRegister(t.SlaveID, fcReadHoldingRegisters, t.Regaddr)
+		if err != nil {
+			return fmt.Errorf("Modbus device %s read error: %s", t.Devfile, err)
+		}
+		t.valmux.Lock()
+		defer t.valmux.Unlock()
+		t.value = float64(int16(regval)) / 10
+		t.hist.Append(time.Now(), t.value)
+		return nil
 	}
-	if _, err := t.serport.Write([]byte(t.Cmdmsb)); err != nil {
-		err = fmt.Errorf("Serial port %s write error: %s", t.Devfile, err)
-		return err
+
+	lsb, err := t.transport.Raw(t.Cmdlsb)
+	if err != nil {
+		return fmt.Errorf("Serial port %s read error: %s", t.Devfile, err)
 	}
-	msb := make([]byte, 1)
-	if _, err := t.serport.Read(msb); err != nil {
-		err = fmt.Errorf("Serial port %s read error: %s", t.Devfile, err)
-		return err
+	msb, err := t.transport.Raw(t.Cmdmsb)
+	if err != nil {
+		return fmt.Errorf("Serial port %s read error: %s", t.Devfile, err)
 	}
 	t.valmux.Lock()
 	defer t.valmux.Unlock()
-	t.value = ConvertTemp(msb[0], lsb[0])
+	t.value = ConvertTemp(msb, lsb)
+	t.hist.Append(time.Now(), t.value)
 	return nil
 }
 
@@ -167,22 +408,48 @@ func (t *Tmpt) ReadValue() error {
 func (sw *Swt) ReadValue() error {
 	sw.sermux.Lock()
 	defer sw.sermux.Unlock()
-	if _, err := sw.serport.Write([]byte(sw.Cmdget)); err != nil {
-		err = fmt.Errorf("Serial port %s write error: %s", sw.Devfile, err)
-		return err
+
+	if sw.Driver == driverMCP23017 {
+		state, err := readMCP23017Bit(sw.bus, sw.Addr, sw.Reg)
+		if err != nil {
+			return fmt.Errorf("I2C device %s read error: %s", sw.Devfile, err)
+		}
+		sw.valmux.Lock()
+		defer sw.valmux.Unlock()
+		sw.value = 0
+		if state {
+			sw.value = 1
+		}
+		sw.hist.Append(time.Now(), float64(sw.value))
+		return nil
 	}
-	res := make([]byte, 1)
-	if _, err := sw.serport.Read(res); err != nil {
-		err = fmt.Errorf("Serial port %s read error: %s", sw.Devfile, err)
-		return err
+
+	if sw.TransportName == transportModbusRTU {
+		state, err := sw.transport.ReadCoil(sw.SlaveID, sw.Coiladdr)
+		if err != nil {
+			return fmt.Errorf("Modbus device %s read error: %s", sw.Devfile, err)
+		}
+		sw.valmux.Lock()
+		defer sw.valmux.Unlock()
+		sw.value = 0
+		if state {
+			sw.value = 1
+		}
+		sw.hist.Append(time.Now(), float64(sw.value))
+		return nil
 	}
-	if (res[0] != 0) && (res[0] != 1) {
-		err := fmt.Errorf("Wrong value of switch %s: %b", sw.ID, res[0])
-		return err
+
+	res, err := sw.transport.Raw(sw.Cmdget)
+	if err != nil {
+		return fmt.Errorf("Serial port %s read error: %s", sw.Devfile, err)
+	}
+	if (res != 0) && (res != 1) {
+		return fmt.Errorf("Wrong value of switch %s: %b", sw.ID, res)
 	}
 	sw.valmux.Lock()
 	defer sw.valmux.Unlock()
-	sw.value = int(res[0])
+	sw.value = int(res)
+	sw.hist.Append(time.Now(), float64(sw.value))
 	return nil
 }
 
@@ -190,18 +457,24 @@ func (sw *Swt) ReadValue() error {
 func (sw *Swt) SetBit() error {
 	sw.sermux.Lock()
 	defer sw.sermux.Unlock()
-	if _, err := sw.serport.Write([]byte(sw.Cmdset)); err != nil {
-		err = fmt.Errorf("Serial port %s write error: %s", sw.Devfile, err)
-		return err
+	if sw.Driver == driverMCP23017 {
+		if err := writeMCP23017Bit(sw.bus, sw.Addr, sw.Reg, true); err != nil {
+			return fmt.Errorf("I2C device %s write error: %s", sw.Devfile, err)
+		}
+		return nil
 	}
-	res := make([]byte, 1)
-	if _, err := sw.serport.Read(res); err != nil {
-		err = fmt.Errorf("Serial port %s read error: %s", sw.Devfile, err)
-		return err
+	if sw.TransportName == transportModbusRTU {
+		if err := sw.transport.WriteCoil(sw.SlaveID, sw.Coiladdr, true); err != nil {
+			return fmt.Errorf("Modbus device %s write error: %s", sw.Devfile, err)
+		}
+		return nil
 	}
-	if res[0] != 'K' {
-		err := fmt.Errorf("Error occurred during setting %s switch bit. Answer is not K.", sw.ID)
-		return err
+	res, err := sw.transport.Raw(sw.Cmdset)
+	if err != nil {
+		return fmt.Errorf("Serial port %s read error: %s", sw.Devfile, err)
+	}
+	if res != 'K' {
+		return fmt.Errorf("Error occurred during setting %s switch bit. Answer is not K.", sw.ID)
 	}
 	return nil
 }
@@ -210,18 +483,24 @@ func (sw *Swt) SetBit() error {
 func (sw *Swt) ClearBit() error {
 	sw.sermux.Lock()
 	defer sw.sermux.Unlock()
-	if _, err := sw.serport.Write([]byte(sw.Cmdclr)); err != nil {
-		err = fmt.Errorf("Serial port %s write error: %s", sw.Devfile, err)
-		return err
+	if sw.Driver == driverMCP23017 {
+		if err := writeMCP23017Bit(sw.bus, sw.Addr, sw.Reg, false); err != nil {
+			return fmt.Errorf("I2C device %s write error: %s", sw.Devfile, err)
+		}
+		return nil
 	}
-	res := make([]byte, 1)
-	if _, err := sw.serport.Read(res); err != nil {
-		err = fmt.Errorf("Serial port %s read error: %s", sw.Devfile, err)
-		return err
+	if sw.TransportName == transportModbusRTU {
+		if err := sw.transport.WriteCoil(sw.SlaveID, sw.Coiladdr, false); err != nil {
+			return fmt.Errorf("Modbus device %s write error: %s", sw.Devfile, err)
+		}
+		return nil
 	}
-	if res[0] != 'K' {
-		err := fmt.Errorf("Error occurred during setting %s switch bit. Answer is not K.", sw.ID)
-		return err
+	res, err := sw.transport.Raw(sw.Cmdclr)
+	if err != nil {
+		return fmt.Errorf("Serial port %s read error: %s", sw.Devfile, err)
+	}
+	if res != 'K' {
+		return fmt.Errorf("Error occurred during setting %s switch bit. Answer is not K.", sw.ID)
 	}
 	return nil
 }
@@ -230,29 +509,73 @@ func (sw *Swt) ClearBit() error {
 // Devfile is path to file of serial port
 // with certain Baud rate.
 type Btdev struct {
-	ID      string
-	Devfile string  `toml:"devfile"`
-	Baud    int     `toml:"baud"`
-	ADCs    []*ADC  `toml:"ADCs"`
-	Tmpts   []*Tmpt `toml:"tmpts"`
-	Swts    []*Swt  `toml:"swts"`
-	serport *serial.Port
-	sermux  sync.Mutex
+	ID            string
+	Devfile       string  `toml:"devfile"`
+	Baud          int     `toml:"baud"`
+	TransportName string  `toml:"transport"`
+	SlaveID       byte    `toml:"slave_id"`
+	ADCs          []*ADC  `toml:"ADCs"`
+	Tmpts         []*Tmpt `toml:"tmpts"`
+	Swts          []*Swt  `toml:"swts"`
+	transport     Transport
+	bus           Bus
+	sermux        sync.Mutex
+	stopCh        chan struct{}
+	stopOnce      sync.Once
+}
+
+// Init prepares btd's runtime state (its stop channel) after it has been
+// decoded from TOML. It must be called once before the device's polling
+// goroutine is started.
+func (btd *Btdev) Init() {
+	btd.stopCh = make(chan struct{})
 }
 
-// OpenPort method for opening port of remote device
+// Stop signals btd's polling goroutine to exit, via the channel returned
+// by Done. It is safe to call more than once.
+func (btd *Btdev) Stop() {
+	btd.stopOnce.Do(func() {
+		close(btd.stopCh)
+	})
+}
+
+// Done returns a channel that is closed once Stop has been called, for
+// the polling goroutine to select on.
+func (btd *Btdev) Done() <-chan struct{} {
+	return btd.stopCh
+}
+
+// OpenPort method for opening port of remote device. If btd.Devfile looks
+// like an I2C adapter (/dev/i2c-*) it is opened as an I2CBus, for items
+// using a native Driver. Otherwise the concrete Transport is picked from
+// btd.TransportName: "modbus-rtu" selects ModbusRTU, anything else
+// (including the empty string) selects RawSerial, the original ad-hoc
+// protocol.
 func (btd *Btdev) OpenPort() error {
-	c := &serial.Config{Name: btd.Devfile, Baud: btd.Baud, ReadTimeout: time.Second * 5}
-	serport, err := serial.OpenPort(c)
-	if err != nil {
-		err = fmt.Errorf("Btdev %s open serial port problem: %s", btd.ID, err)
-		return err
+	if isI2CDevfile(btd.Devfile) {
+		btd.bus = &I2CBus{}
+		if err := btd.bus.Open(btd.Devfile); err != nil {
+			return fmt.Errorf("Btdev %s open I2C bus problem: %s", btd.ID, err)
+		}
+		return nil
+	}
+	switch btd.TransportName {
+	case transportModbusRTU:
+		btd.transport = &ModbusRTU{}
+	default:
+		btd.transport = &RawSerial{}
+	}
+	if err := btd.transport.Open(btd.Devfile, btd.Baud); err != nil {
+		return fmt.Errorf("Btdev %s open serial port problem: %s", btd.ID, err)
 	}
-	btd.serport = serport
 	return nil
 }
 
 // ClosePort method for opening port of remote device
 func (btd *Btdev) ClosePort() {
-	btd.serport.Close()
+	if btd.bus != nil {
+		btd.bus.Close()
+		return
+	}
+	btd.transport.Close()
 }
@@ -0,0 +1,149 @@
+package btrd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// i2cSlavePrefix is the devfile prefix that selects the I2CBus backend
+// instead of the default serial Transport.
+const i2cSlavePrefix = "/dev/i2c-"
+
+// i2cSlave is the ioctl request number (I2C_SLAVE from linux/i2c-dev.h)
+// used to bind the bus to a slave address before a read/write.
+const i2cSlave = 0x0703
+
+// Bus is a register-oriented peripheral bus, as opposed to the
+// command/response Transport used by the original serial protocol. It is
+// implemented by I2CBus and lets ADC/Tmpt/Swt items with a native driver
+// talk to chips addressed by a slave address and register number.
+type Bus interface {
+	Open(devfile string) error
+	Close()
+	ReadByte(addr byte) (byte, error)
+	WriteByte(addr byte, v byte) error
+	ReadFromReg(addr byte, reg byte, buf []byte) error
+	WriteToReg(addr byte, reg byte, v byte) error
+	WriteWordToReg(addr byte, reg byte, v uint16) error
+	ReadWordFromReg(addr byte, reg byte) (uint16, error)
+}
+
+// I2CBus is a Bus implementation backed by a Linux /dev/i2c-* character
+// device, addressed via the I2C_SLAVE ioctl.
+type I2CBus struct {
+	file *os.File
+}
+
+// Open opens the I2C adapter character device.
+func (b *I2CBus) Open(devfile string) error {
+	file, err := os.OpenFile(devfile, os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("I2CBus open %s error: %s", devfile, err)
+	}
+	b.file = file
+	return nil
+}
+
+// Close closes the I2C adapter character device.
+func (b *I2CBus) Close() {
+	b.file.Close()
+}
+
+// setSlave binds the adapter to addr for the next transfer.
+func (b *I2CBus) setSlave(addr byte) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, b.file.Fd(), uintptr(i2cSlave), uintptr(addr))
+	if errno != 0 {
+		return fmt.Errorf("I2CBus I2C_SLAVE ioctl error: %s", errno)
+	}
+	return nil
+}
+
+// ReadByte reads a single byte from the device at addr with no register
+// selection, for simple devices that have no register pointer.
+func (b *I2CBus) ReadByte(addr byte) (byte, error) {
+	if err := b.setSlave(addr); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 1)
+	if _, err := b.file.Read(buf); err != nil {
+		return 0, fmt.Errorf("I2CBus read error: %s", err)
+	}
+	return buf[0], nil
+}
+
+// WriteByte writes a single byte to the device at addr with no register
+// selection.
+func (b *I2CBus) WriteByte(addr byte, v byte) error {
+	if err := b.setSlave(addr); err != nil {
+		return err
+	}
+	if _, err := b.file.Write([]byte{v}); err != nil {
+		return fmt.Errorf("I2CBus write error: %s", err)
+	}
+	return nil
+}
+
+// ReadFromReg reads len(buf) bytes starting at register reg of the
+// device at addr.
+func (b *I2CBus) ReadFromReg(addr byte, reg byte, buf []byte) error {
+	if err := b.setSlave(addr); err != nil {
+		return err
+	}
+	if _, err := b.file.Write([]byte{reg}); err != nil {
+		return fmt.Errorf("I2CBus write register error: %s", err)
+	}
+	if _, err := b.file.Read(buf); err != nil {
+		return fmt.Errorf("I2CBus read error: %s", err)
+	}
+	return nil
+}
+
+// WriteToReg writes v to register reg of the device at addr.
+func (b *I2CBus) WriteToReg(addr byte, reg byte, v byte) error {
+	if err := b.setSlave(addr); err != nil {
+		return err
+	}
+	if _, err := b.file.Write([]byte{reg, v}); err != nil {
+		return fmt.Errorf("I2CBus write register error: %s", err)
+	}
+	return nil
+}
+
+// WriteWordToReg writes a big-endian 16-bit word to register reg of the
+// device at addr, as used by e.g. the ADS1115 config register (OS/MUX/PGA/
+// mode in the high byte, data rate/comparator settings in the low byte).
+func (b *I2CBus) WriteWordToReg(addr byte, reg byte, v uint16) error {
+	if err := b.setSlave(addr); err != nil {
+		return err
+	}
+	if _, err := b.file.Write([]byte{reg, byte(v >> 8), byte(v)}); err != nil {
+		return fmt.Errorf("I2CBus write register error: %s", err)
+	}
+	return nil
+}
+
+// ReadWordFromReg reads a big-endian 16-bit word starting at register reg
+// of the device at addr, as used by e.g. the ADS1115 conversion register.
+func (b *I2CBus) ReadWordFromReg(addr byte, reg byte) (uint16, error) {
+	buf := make([]byte, 2)
+	if err := b.ReadFromReg(addr, reg, buf); err != nil {
+		return 0, err
+	}
+	return uint16(buf[0])<<8 | uint16(buf[1]), nil
+}
+
+// isI2CDevfile reports whether devfile names an I2C adapter rather than a
+// serial port, based on the conventional /dev/i2c-N naming.
+func isI2CDevfile(devfile string) bool {
+	return strings.HasPrefix(devfile, i2cSlavePrefix)
+}
+
+// IsI2CDevfile reports whether devfile names an I2C adapter rather than a
+// serial port. It is exported so config validation (e.g. restapi's
+// loadConfig) can reject an item Driver that requires an I2CBus before
+// OpenPort ever runs, rather than leaving its bus nil.
+func IsI2CDevfile(devfile string) bool {
+	return isI2CDevfile(devfile)
+}
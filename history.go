@@ -0,0 +1,97 @@
+package btrd
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultHistSize is the ring buffer capacity used when an item's
+// HistSize is not set in its TOML config.
+const defaultHistSize = 1000
+
+// Sample is one timestamped reading recorded into a History ring buffer.
+type Sample struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// History is a fixed-capacity ring buffer of timestamped samples plus an
+// optional retention window; old samples are dropped both on overflow
+// and once older than the retention window. It also fans out every appended sample
+// to subscribers registered via Subscribe, for push-based consumers such
+// as the MQTT bridge or a websocket handler.
+type History struct {
+	mu        sync.Mutex
+	samples   []Sample
+	size      int
+	retention time.Duration
+	subs      []chan Sample
+}
+
+// NewHistory creates a History that keeps at most size samples (0 uses
+// defaultHistSize) and drops samples older than retention once retention
+// is positive.
+func NewHistory(size int, retention time.Duration) *History {
+	if size <= 0 {
+		size = defaultHistSize
+	}
+	return &History{size: size, retention: retention}
+}
+
+// Append records value at t, evicting samples that overflow the ring
+// buffer's size or fall outside the retention window, then pushes the
+// new sample to every subscriber. Slow subscribers drop the sample
+// instead of blocking Append.
+func (h *History) Append(t time.Time, value float64) {
+	sample := Sample{Time: t, Value: value}
+
+	h.mu.Lock()
+	h.samples = append(h.samples, sample)
+	if len(h.samples) > h.size {
+		h.samples = h.samples[len(h.samples)-h.size:]
+	}
+	if h.retention > 0 {
+		cutoff := t.Add(-h.retention)
+		i := 0
+		for i < len(h.samples) && h.samples[i].Time.Before(cutoff) {
+			i++
+		}
+		h.samples = h.samples[i:]
+	}
+	subs := append([]chan Sample(nil), h.subs...)
+	h.mu.Unlock()
+
+	for _, ch := range subs {
+		select {
+		case ch <- sample:
+		default:
+		}
+	}
+}
+
+// Since returns every retained sample recorded at or after since, oldest
+// first.
+func (h *History) Since(since time.Time) []Sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]Sample, 0, len(h.samples))
+	for _, s := range h.samples {
+		if !s.Time.Before(since) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Subscribe returns a channel that receives samples appended after this
+// call. The channel buffers 16 samples; while it is full, Append drops
+// new samples for it. The channel is never closed; callers that no longer need it
+// should simply stop reading from it and let it be garbage collected
+// along with the History.
+func (h *History) Subscribe() <-chan Sample {
+	ch := make(chan Sample, 16)
+	h.mu.Lock()
+	h.subs = append(h.subs, ch)
+	h.mu.Unlock()
+	return ch
+}
@@ -0,0 +1,63 @@
+package btrd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistoryAppendEvictsOnSize(t *testing.T) {
+	h := NewHistory(2, 0)
+	base := time.Unix(1000, 0)
+	h.Append(base, 1)
+	h.Append(base.Add(time.Second), 2)
+	h.Append(base.Add(2*time.Second), 3)
+
+	got := h.Since(time.Time{})
+	if len(got) != 2 {
+		t.Fatalf("len(got) = %d, want 2", len(got))
+	}
+	if got[0].Value != 2 || got[1].Value != 3 {
+		t.Errorf("got = %+v, want values [2 3]", got)
+	}
+}
+
+func TestHistoryAppendEvictsOnRetention(t *testing.T) {
+	h := NewHistory(0, 5*time.Second)
+	base := time.Unix(1000, 0)
+	h.Append(base, 1)
+	h.Append(base.Add(10*time.Second), 2)
+
+	got := h.Since(time.Time{})
+	if len(got) != 1 || got[0].Value != 2 {
+		t.Errorf("got = %+v, want only the sample within the retention window", got)
+	}
+}
+
+func TestHistorySince(t *testing.T) {
+	h := NewHistory(0, 0)
+	base := time.Unix(1000, 0)
+	h.Append(base, 1)
+	h.Append(base.Add(time.Second), 2)
+	h.Append(base.Add(2*time.Second), 3)
+
+	got := h.Since(base.Add(time.Second))
+	if len(got) != 2 || got[0].Value != 2 || got[1].Value != 3 {
+		t.Errorf("Since(base+1s) = %+v, want values [2 3]", got)
+	}
+}
+
+func TestHistorySubscribe(t *testing.T) {
+	h := NewHistory(0, 0)
+	ch := h.Subscribe()
+
+	h.Append(time.Unix(1000, 0), 42)
+
+	select {
+	case s := <-ch:
+		if s.Value != 42 {
+			t.Errorf("subscriber got value %v, want 42", s.Value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscriber never received the appended sample")
+	}
+}
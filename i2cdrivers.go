@@ -0,0 +1,118 @@
+package btrd
+
+import (
+	"fmt"
+	"time"
+)
+
+// Driver names accepted by the ADC/Tmpt/Swt "driver" TOML field when the
+// owning Btdev is backed by an I2CBus. The empty string keeps the
+// existing raw serial (or Modbus) protocol as the default.
+const (
+	driverADS1115  = "ads1115"
+	driverTMP006   = "tmp006"
+	driverLM75     = "lm75"
+	driverMCP23017 = "mcp23017"
+)
+
+// ADS1115 conversion register and the bits of its config register used
+// to start a single-shot conversion on the configured input. ads1115OSReady
+// is the config register's OS bit, which reads back 0 while a single-shot
+// conversion is in progress and 1 once it's ready.
+const (
+	ads1115RegConversion = 0x00
+	ads1115RegConfig     = 0x01
+	ads1115OSReady       = 1 << 15
+)
+
+// ads1115ConversionTimeout bounds how long readADS1115 polls the OS bit
+// before giving up; the slowest ADS1115 data rate (8 SPS) takes up to
+// ~125ms to complete a conversion.
+const ads1115ConversionTimeout = 150 * time.Millisecond
+const ads1115PollInterval = 1 * time.Millisecond
+
+// readADS1115 triggers a single-shot conversion on addr/reg (the
+// pre-built 16-bit config register value), polls the config register's OS
+// bit until the conversion completes, and returns the signed 16-bit
+// result from the ADS1115 conversion register.
+func readADS1115(bus Bus, addr byte, reg uint16) (int16, error) {
+	if err := bus.WriteWordToReg(addr, ads1115RegConfig, reg); err != nil {
+		return 0, fmt.Errorf("ADS1115 config write error: %s", err)
+	}
+
+	deadline := time.Now().Add(ads1115ConversionTimeout)
+	for {
+		cfg, err := bus.ReadWordFromReg(addr, ads1115RegConfig)
+		if err != nil {
+			return 0, fmt.Errorf("ADS1115 config read error: %s", err)
+		}
+		if cfg&ads1115OSReady != 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("ADS1115 conversion timed out")
+		}
+		time.Sleep(ads1115PollInterval)
+	}
+
+	word, err := bus.ReadWordFromReg(addr, ads1115RegConversion)
+	if err != nil {
+		return 0, fmt.Errorf("ADS1115 conversion read error: %s", err)
+	}
+	return int16(word), nil
+}
+
+// readTMP006 reads the TMP006 die temperature register and converts it
+// to degrees Celsius (register units are 1/32 degC in the top 14 bits).
+func readTMP006(bus Bus, addr byte, reg byte) (float64, error) {
+	word, err := bus.ReadWordFromReg(addr, reg)
+	if err != nil {
+		return 0, fmt.Errorf("TMP006 read error: %s", err)
+	}
+	return float64(int16(word)>>2) * 0.03125, nil
+}
+
+// readLM75 reads the LM75 temperature register and converts it to
+// degrees Celsius (register units are 0.5 degC in the top 9 bits).
+func readLM75(bus Bus, addr byte, reg byte) (float64, error) {
+	word, err := bus.ReadWordFromReg(addr, reg)
+	if err != nil {
+		return 0, fmt.Errorf("LM75 read error: %s", err)
+	}
+	return float64(int16(word)>>7) * 0.5, nil
+}
+
+// MCP23017 register addresses used for bank 0 GPIOA.
+const (
+	mcp23017RegGPIO = 0x12
+	mcp23017RegOLAT = 0x14
+)
+
+// readMCP23017Bit reads pin number pin (0-7) of the MCP23017's GPIOA
+// port at addr.
+func readMCP23017Bit(bus Bus, addr byte, pin byte) (bool, error) {
+	buf := make([]byte, 1)
+	if err := bus.ReadFromReg(addr, mcp23017RegGPIO, buf); err != nil {
+		return false, fmt.Errorf("MCP23017 read error: %s", err)
+	}
+	return buf[0]&(1<<pin) != 0, nil
+}
+
+// writeMCP23017Bit sets or clears pin number pin (0-7) of the MCP23017's
+// GPIOA output latch at addr.
+func writeMCP23017Bit(bus Bus, addr byte, pin byte, value bool) error {
+	buf := make([]byte, 1)
+	if err := bus.ReadFromReg(addr, mcp23017RegOLAT, buf); err != nil {
+		return fmt.Errorf("MCP23017 read error: %s", err)
+	}
+	latch := buf[0]
+	if value {
+		latch |= 1 << pin
+	} else {
+		latch &^= 1 << pin
+	}
+	if err := bus.WriteToReg(addr, mcp23017RegOLAT, latch); err != nil {
+		return fmt.Errorf("MCP23017 write error: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package btrd
+
+import "testing"
+
+// fakeBus is a Bus implementation backed by in-memory register maps, used
+// to exercise the chip drivers in i2cdrivers.go without real I2C hardware.
+type fakeBus struct {
+	words      map[byte]uint16 // reg -> word, for ReadWordFromReg
+	regs       map[byte]byte   // reg -> byte, for ReadFromReg/WriteToReg
+	wordWrites map[byte]uint16 // reg -> word, for WriteWordToReg
+	writes     []byte          // regs written via WriteToReg, in order
+	wordReads  func(reg byte) (uint16, error)
+}
+
+func (b *fakeBus) Open(devfile string) error { return nil }
+func (b *fakeBus) Close()                    {}
+
+func (b *fakeBus) ReadByte(addr byte) (byte, error)  { return b.regs[0], nil }
+func (b *fakeBus) WriteByte(addr byte, v byte) error { return nil }
+
+func (b *fakeBus) ReadFromReg(addr byte, reg byte, buf []byte) error {
+	buf[0] = b.regs[reg]
+	return nil
+}
+
+func (b *fakeBus) WriteToReg(addr byte, reg byte, v byte) error {
+	if b.regs == nil {
+		b.regs = make(map[byte]byte)
+	}
+	b.regs[reg] = v
+	b.writes = append(b.writes, reg)
+	return nil
+}
+
+func (b *fakeBus) WriteWordToReg(addr byte, reg byte, v uint16) error {
+	if b.wordWrites == nil {
+		b.wordWrites = make(map[byte]uint16)
+	}
+	b.wordWrites[reg] = v
+	return nil
+}
+
+func (b *fakeBus) ReadWordFromReg(addr byte, reg byte) (uint16, error) {
+	if b.wordReads != nil {
+		return b.wordReads(reg)
+	}
+	return b.words[reg], nil
+}
+
+func TestReadTMP006(t *testing.T) {
+	bus := &fakeBus{words: map[byte]uint16{0x01: uint16(int16(800) << 2)}}
+	got, err := readTMP006(bus, 0x40, 0x01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 25.0; got != want {
+		t.Errorf("readTMP006 = %v, want %v", got, want)
+	}
+}
+
+func TestReadLM75(t *testing.T) {
+	bus := &fakeBus{words: map[byte]uint16{0x00: uint16(int16(50) << 7)}}
+	got, err := readLM75(bus, 0x48, 0x00)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 25.0; got != want {
+		t.Errorf("readLM75 = %v, want %v", got, want)
+	}
+}
+
+func TestReadMCP23017Bit(t *testing.T) {
+	bus := &fakeBus{regs: map[byte]byte{mcp23017RegGPIO: 1 << 3}}
+	got, err := readMCP23017Bit(bus, 0x20, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got {
+		t.Errorf("readMCP23017Bit(pin 3) = false, want true")
+	}
+	if got, _ := readMCP23017Bit(bus, 0x20, 4); got {
+		t.Errorf("readMCP23017Bit(pin 4) = true, want false")
+	}
+}
+
+func TestWriteMCP23017Bit(t *testing.T) {
+	bus := &fakeBus{regs: map[byte]byte{mcp23017RegOLAT: 1 << 2}}
+	if err := writeMCP23017Bit(bus, 0x20, 5, true); err != nil {
+		t.Fatal(err)
+	}
+	if want := byte(1<<2 | 1<<5); bus.regs[mcp23017RegOLAT] != want {
+		t.Errorf("OLAT after set = %08b, want %08b", bus.regs[mcp23017RegOLAT], want)
+	}
+	if err := writeMCP23017Bit(bus, 0x20, 2, false); err != nil {
+		t.Fatal(err)
+	}
+	if want := byte(1 << 5); bus.regs[mcp23017RegOLAT] != want {
+		t.Errorf("OLAT after clear = %08b, want %08b", bus.regs[mcp23017RegOLAT], want)
+	}
+}
+
+// ads1115TestConfig is a realistic single-shot config word (MUX=AIN0,
+// PGA=+-4.096V, data rate 860SPS, comparator disabled) with bits set in
+// both the high and low byte, used to catch a config write that silently
+// truncates to 8 bits.
+const ads1115TestConfig = 0xC3E3
+
+// TestReadADS1115WaitsForConversion verifies readADS1115 polls the config
+// register's OS bit rather than trusting the conversion register to be
+// ready immediately after the config write, and that it writes the full
+// 16-bit config word rather than truncating it to a byte.
+func TestReadADS1115WaitsForConversion(t *testing.T) {
+	reads := 0
+	bus := &fakeBus{
+		wordReads: func(reg byte) (uint16, error) {
+			if reg == ads1115RegConversion {
+				return 0x1234, nil
+			}
+			reads++
+			if reads < 3 {
+				return 0, nil // OS bit clear: conversion still running
+			}
+			return ads1115OSReady, nil
+		},
+	}
+	got, err := readADS1115(bus, 0x48, ads1115TestConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reads < 3 {
+		t.Errorf("readADS1115 returned after %d config reads, want it to wait for the OS bit", reads)
+	}
+	if got != 0x1234 {
+		t.Errorf("readADS1115 = %#x, want %#x", got, 0x1234)
+	}
+	if got := bus.wordWrites[ads1115RegConfig]; got != ads1115TestConfig {
+		t.Errorf("config register written = %#04x, want the full 16-bit %#04x", got, uint16(ads1115TestConfig))
+	}
+}
+
+// TestReadADS1115Timeout verifies readADS1115 gives up instead of polling
+// the OS bit forever when a conversion never completes.
+func TestReadADS1115Timeout(t *testing.T) {
+	bus := &fakeBus{
+		wordReads: func(reg byte) (uint16, error) { return 0, nil },
+	}
+	if _, err := readADS1115(bus, 0x48, ads1115TestConfig); err == nil {
+		t.Error("readADS1115 = nil error, want a timeout error")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/vagabundor/btrd"
+)
+
+// historian is implemented by ADC, Tmpt and Swt: anything with its own
+// sample History.
+type historian interface {
+	History() *btrd.History
+}
+
+// historyHandler serves GET /:btdevID/:itemtypes/:itemID/history. Query
+// parameters:
+//
+//	since  - RFC3339 timestamp; only samples at or after it are returned
+//	         (default: every retained sample)
+//	format - "json" (default) or "csv"
+//	agg    - "min", "max" or "avg"; when set, bucket must be set too
+//	bucket - a duration (e.g. "1m") samples are grouped into before agg
+//	         is applied
+func historyHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	btd, ok := getDevice(ps.ByName("btdevID"))
+	if !ok {
+		w.WriteHeader(400)
+		return
+	}
+
+	var h historian
+	switch ps.ByName("itemtypes") {
+	case "adcs":
+		for _, itv := range btd.ADCs {
+			if itv.ID == ps.ByName("itemID") {
+				h = itv
+			}
+		}
+	case "tmpts":
+		for _, itv := range btd.Tmpts {
+			if itv.ID == ps.ByName("itemID") {
+				h = itv
+			}
+		}
+	case "swts":
+		for _, itv := range btd.Swts {
+			if itv.ID == ps.ByName("itemID") {
+				h = itv
+			}
+		}
+	}
+	if h == nil {
+		w.WriteHeader(400)
+		return
+	}
+
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "invalid since: %s\n", err)
+			return
+		}
+		since = t
+	}
+	samples := h.History().Since(since)
+
+	if agg := r.URL.Query().Get("agg"); agg != "" {
+		bucket, err := time.ParseDuration(r.URL.Query().Get("bucket"))
+		if err != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "invalid bucket: %s\n", err)
+			return
+		}
+		samples, err = aggregate(samples, agg, bucket)
+		if err != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "%s\n", err)
+			return
+		}
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		writeHistoryCSV(w, samples)
+		return
+	}
+	writeHistoryJSON(w, samples)
+}
+
+func writeHistoryJSON(w http.ResponseWriter, samples []btrd.Sample) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(samples); err != nil {
+		log.Println("history: encode error:", err)
+	}
+}
+
+func writeHistoryCSV(w http.ResponseWriter, samples []btrd.Sample) {
+	w.Header().Set("Content-Type", "text/csv")
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+	for _, s := range samples {
+		cw.Write([]string{s.Time.Format(time.RFC3339), strconv.FormatFloat(s.Value, 'f', -1, 64)})
+	}
+}
+
+// aggregate groups samples into consecutive buckets of width bucket,
+// anchored to the first sample's time, and reduces each bucket to a
+// single sample via agg ("min", "max" or "avg") timestamped at the
+// bucket's start.
+func aggregate(samples []btrd.Sample, agg string, bucket time.Duration) ([]btrd.Sample, error) {
+	if bucket <= 0 {
+		return nil, fmt.Errorf("bucket must be positive")
+	}
+	if len(samples) == 0 {
+		return samples, nil
+	}
+
+	var reduce func([]float64) float64
+	switch agg {
+	case "min":
+		reduce = func(vs []float64) float64 {
+			m := vs[0]
+			for _, v := range vs[1:] {
+				if v < m {
+					m = v
+				}
+			}
+			return m
+		}
+	case "max":
+		reduce = func(vs []float64) float64 {
+			m := vs[0]
+			for _, v := range vs[1:] {
+				if v > m {
+					m = v
+				}
+			}
+			return m
+		}
+	case "avg":
+		reduce = func(vs []float64) float64 {
+			sum := 0.0
+			for _, v := range vs {
+				sum += v
+			}
+			return sum / float64(len(vs))
+		}
+	default:
+		return nil, fmt.Errorf("unknown agg %q", agg)
+	}
+
+	var out []btrd.Sample
+	bucketStart := samples[0].Time
+	var vs []float64
+	for _, s := range samples {
+		for s.Time.Sub(bucketStart) >= bucket {
+			if len(vs) > 0 {
+				out = append(out, btrd.Sample{Time: bucketStart, Value: reduce(vs)})
+				vs = nil
+			}
+			bucketStart = bucketStart.Add(bucket)
+		}
+		vs = append(vs, s.Value)
+	}
+	if len(vs) > 0 {
+		out = append(out, btrd.Sample{Time: bucketStart, Value: reduce(vs)})
+	}
+	return out, nil
+}
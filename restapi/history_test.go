@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vagabundor/btrd"
+)
+
+func TestAggregateBucketsAndReduces(t *testing.T) {
+	base := time.Unix(1000, 0)
+	samples := []btrd.Sample{
+		{Time: base, Value: 1},
+		{Time: base.Add(30 * time.Second), Value: 3},
+		{Time: base.Add(90 * time.Second), Value: 10},
+		{Time: base.Add(95 * time.Second), Value: 20},
+	}
+
+	got, err := aggregate(samples, "avg", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []btrd.Sample{
+		{Time: base, Value: 2},                        // avg(1, 3), bucket [0s, 60s)
+		{Time: base.Add(60 * time.Second), Value: 15}, // avg(10, 20), bucket [60s, 120s)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("aggregate returned %d buckets, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Value != want[i].Value {
+			t.Errorf("bucket %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestAggregateMinMax(t *testing.T) {
+	base := time.Unix(1000, 0)
+	samples := []btrd.Sample{
+		{Time: base, Value: 5},
+		{Time: base.Add(time.Second), Value: 1},
+		{Time: base.Add(2 * time.Second), Value: 9},
+	}
+
+	min, err := aggregate(samples, "min", time.Minute)
+	if err != nil || len(min) != 1 || min[0].Value != 1 {
+		t.Errorf("aggregate(min) = %+v, err %v, want a single bucket with value 1", min, err)
+	}
+
+	max, err := aggregate(samples, "max", time.Minute)
+	if err != nil || len(max) != 1 || max[0].Value != 9 {
+		t.Errorf("aggregate(max) = %+v, err %v, want a single bucket with value 9", max, err)
+	}
+}
+
+func TestAggregateRejectsUnknownAggAndBucket(t *testing.T) {
+	samples := []btrd.Sample{{Time: time.Unix(1000, 0), Value: 1}}
+
+	if _, err := aggregate(samples, "median", time.Minute); err == nil {
+		t.Error("aggregate(median) = nil error, want an error for an unknown agg")
+	}
+	if _, err := aggregate(samples, "avg", 0); err == nil {
+		t.Error("aggregate(avg, bucket=0) = nil error, want an error for a non-positive bucket")
+	}
+}
+
+func TestAggregateEmptyInput(t *testing.T) {
+	got, err := aggregate(nil, "avg", time.Minute)
+	if err != nil || len(got) != 0 {
+		t.Errorf("aggregate(nil) = %+v, err %v, want an empty result and no error", got, err)
+	}
+}
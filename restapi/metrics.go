@@ -0,0 +1,54 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics exposed on /metrics, updated from the polling loop
+// in main as each item is read.
+var (
+	adcValue = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "btrd_adc_value",
+		Help: "Current value of an ADC item.",
+	}, []string{"device", "id"})
+
+	temperatureCelsius = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "btrd_temperature_celsius",
+		Help: "Current value of a Tmpt item, in degrees Celsius.",
+	}, []string{"device", "id"})
+
+	switchState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "btrd_switch_state",
+		Help: "Current state of a Swt item (0 or 1).",
+	}, []string{"device", "id"})
+
+	readErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "btrd_read_errors_total",
+		Help: "Total number of failed ReadValue calls.",
+	}, []string{"device", "item_type", "id"})
+
+	serialReopensTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "btrd_serial_reopens_total",
+		Help: "Total number of times a device's port was reopened after repeated errors.",
+	}, []string{"device"})
+
+	readLatencySeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "btrd_read_latency_seconds",
+		Help: "Latency of a single item ReadValue call.",
+	}, []string{"device", "item_type", "id"})
+)
+
+// observeRead times fn, an item's ReadValue method, recording the call's
+// latency and, on failure, incrementing readErrorsTotal.
+func observeRead(device, itemType, id string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	readLatencySeconds.WithLabelValues(device, itemType, id).Observe(time.Since(start).Seconds())
+	if err != nil {
+		readErrorsTotal.WithLabelValues(device, itemType, id).Inc()
+	}
+	return err
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/vagabundor/btrd"
+)
+
+// mqttBridgeInst is the running MQTT bridge, or nil if no [mqtt] section
+// was present in the config.
+var mqttBridgeInst *mqttBridge
+
+// MQTTConfig configures the optional MQTT bridge, enabled by adding a
+// [mqtt] section to the TOML config file.
+type MQTTConfig struct {
+	Broker    string `toml:"broker"`
+	ClientID  string `toml:"client_id"`
+	Username  string `toml:"username"`
+	Password  string `toml:"password"`
+	TLS       bool   `toml:"tls"`
+	QoS       byte   `toml:"qos"`
+	BaseTopic string `toml:"base_topic"`
+}
+
+// mqttPublishQueueSize bounds how many pending state publishes
+// publishState will buffer for the publish worker before it starts
+// dropping them; see runPublisher.
+const mqttPublishQueueSize = 64
+
+// stateUpdate is a pending publishState call, queued for the publish
+// worker goroutine.
+type stateUpdate struct {
+	topic   string
+	payload string
+}
+
+// mqttBridge publishes ADC/Tmpt readings to "<base>/<btdevID>/<itemtype>/<itemID>/state"
+// and subscribes to the matching "/set" topics for Swt items, sharing the
+// same devices map as the HTTP API. It runs in parallel with the HTTP
+// API and reconnects with backoff on disconnect.
+type mqttBridge struct {
+	cfg     *MQTTConfig
+	client  mqtt.Client
+	updates chan stateUpdate
+}
+
+// newMQTTBridge builds a bridge from cfg. The underlying client
+// reconnects automatically; onConnect re-subscribes and republishes
+// discovery messages every time the connection (re)establishes.
+func newMQTTBridge(cfg *MQTTConfig) *mqttBridge {
+	b := &mqttBridge{cfg: cfg, updates: make(chan stateUpdate, mqttPublishQueueSize)}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5 * time.Second).
+		SetOnConnectHandler(b.onConnect)
+	if cfg.TLS {
+		opts.SetTLSConfig(&tls.Config{})
+	}
+
+	b.client = mqtt.NewClient(opts)
+	go b.runPublisher()
+	return b
+}
+
+// runPublisher drains updates and publishes them one at a time, so a
+// slow or stalled broker ack only stalls this goroutine and never the
+// per-Btdev poll scheduler that called publishState.
+func (b *mqttBridge) runPublisher() {
+	for u := range b.updates {
+		token := b.client.Publish(u.topic, b.cfg.QoS, false, u.payload)
+		token.Wait()
+		if err := token.Error(); err != nil {
+			log.Println("mqtt: publish error:", err)
+		}
+	}
+}
+
+// connect blocks until the initial connection attempt completes.
+func (b *mqttBridge) connect() error {
+	token := b.client.Connect()
+	token.Wait()
+	return token.Error()
+}
+
+// onConnect re-subscribes to every Swt's "set" topic and publishes Home
+// Assistant discovery messages for every known item.
+func (b *mqttBridge) onConnect(client mqtt.Client) {
+	devicesMu.RLock()
+	defer devicesMu.RUnlock()
+	for _, btd := range devices {
+		for _, adc := range btd.ADCs {
+			b.publishDiscovery(btd.ID, "sensor", adc.ID, b.stateTopic(btd.ID, "adcs", adc.ID), "")
+		}
+		for _, tp := range btd.Tmpts {
+			b.publishDiscovery(btd.ID, "sensor", tp.ID, b.stateTopic(btd.ID, "tmpts", tp.ID), "")
+		}
+		for _, sw := range btd.Swts {
+			b.subscribeSwt(sw)
+			b.publishDiscovery(btd.ID, "switch", sw.ID, b.stateTopic(btd.ID, "swts", sw.ID), b.setTopic(btd.ID, "swts", sw.ID))
+		}
+	}
+}
+
+func (b *mqttBridge) stateTopic(btdevID, itemtype, id string) string {
+	return fmt.Sprintf("%s/%s/%s/%s/state", b.cfg.BaseTopic, btdevID, itemtype, id)
+}
+
+func (b *mqttBridge) setTopic(btdevID, itemtype, id string) string {
+	return fmt.Sprintf("%s/%s/%s/%s/set", b.cfg.BaseTopic, btdevID, itemtype, id)
+}
+
+// subscribeSwt subscribes to sw's "set" topic, invoking SetBit/ClearBit
+// on "true"/"false" payloads and republishing the resulting state.
+func (b *mqttBridge) subscribeSwt(sw *btrd.Swt) {
+	topic := b.setTopic(sw.Btdev.ID, "swts", sw.ID)
+	token := b.client.Subscribe(topic, b.cfg.QoS, func(client mqtt.Client, msg mqtt.Message) {
+		var err error
+		state := "false"
+		switch string(msg.Payload()) {
+		case "true", "ON", "1":
+			err = sw.SetBit()
+			state = "true"
+		case "false", "OFF", "0":
+			err = sw.ClearBit()
+		default:
+			log.Printf("mqtt: unknown payload %q on %s", msg.Payload(), topic)
+			return
+		}
+		if err != nil {
+			log.Println("mqtt:", err)
+			return
+		}
+		b.publishState(sw.Btdev.ID, "swts", sw.ID, state)
+	})
+	token.Wait()
+	if err := token.Error(); err != nil {
+		log.Println("mqtt: subscribe error:", err)
+	}
+}
+
+// publishState queues payload for publication to the state topic of the
+// given item. It never blocks: it hands off to the publish worker
+// goroutine over a buffered channel so a slow broker ack can't stall the
+// poll scheduler calling it, dropping the update if the worker has
+// fallen too far behind.
+func (b *mqttBridge) publishState(btdevID, itemtype, id, payload string) {
+	u := stateUpdate{topic: b.stateTopic(btdevID, itemtype, id), payload: payload}
+	select {
+	case b.updates <- u:
+	default:
+		log.Printf("mqtt: publish queue full, dropping state update for %s", u.topic)
+	}
+}
+
+// haDiscoveryPayload is the minimal Home Assistant MQTT discovery
+// payload for a sensor or switch entity.
+type haDiscoveryPayload struct {
+	Name         string `json:"name"`
+	StateTopic   string `json:"state_topic"`
+	CommandTopic string `json:"command_topic,omitempty"`
+	UniqueID     string `json:"unique_id"`
+}
+
+// publishDiscovery publishes a retained Home Assistant discovery message
+// for component ("sensor" or "switch") so the item auto-registers.
+func (b *mqttBridge) publishDiscovery(btdevID, component, itemID, stateTopic, commandTopic string) {
+	payload := haDiscoveryPayload{
+		Name:         fmt.Sprintf("%s %s", btdevID, itemID),
+		StateTopic:   stateTopic,
+		CommandTopic: commandTopic,
+		UniqueID:     fmt.Sprintf("btrd_%s_%s", btdevID, itemID),
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Println("mqtt: discovery marshal error:", err)
+		return
+	}
+	topic := fmt.Sprintf("homeassistant/%s/btrd_%s_%s/config", component, btdevID, itemID)
+	token := b.client.Publish(topic, b.cfg.QoS, true, body)
+	token.Wait()
+	if err := token.Error(); err != nil {
+		log.Println("mqtt: discovery publish error:", err)
+	}
+}
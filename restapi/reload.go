@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/vagabundor/btrd"
+)
+
+// devices holds the set of currently running Btdevs, keyed by ID, guarded
+// by devicesMu so the HTTP handlers and the reload subsystem can access
+// it concurrently.
+var (
+	devices   map[string]*btrd.Btdev
+	devicesMu sync.RWMutex
+)
+
+// getDevice looks up a device by ID under devicesMu.
+func getDevice(id string) (*btrd.Btdev, bool) {
+	devicesMu.RLock()
+	defer devicesMu.RUnlock()
+	btd, ok := devices[id]
+	return btd, ok
+}
+
+// adcSig, tmptSig and swtSig mirror the TOML-tagged config fields of
+// ADC/Tmpt/Swt, without their embedded *Btdev back-reference (or their
+// unexported runtime state, e.g. valmux). ADC/Tmpt/Swt each point back to
+// their owning Btdev, so formatting one of them directly, or a Btdev that
+// holds them, recurses forever (Btdev -> item -> Btdev -> ...); these
+// structs hold only what reload needs to detect a configuration change.
+type adcSig struct {
+	ID, Cmdget, Expr, Driver               string
+	Fc, Addr                               byte
+	Reg, Regaddr                           uint16
+	Vref, Deadband                         float64
+	IntervalMs, HistSize, HistRetentionSec int
+}
+
+func newADCSig(a *btrd.ADC) adcSig {
+	return adcSig{
+		ID: a.ID, Vref: a.Vref, Cmdget: a.Cmdget, Expr: a.Expr, Fc: a.Fc,
+		Regaddr: a.Regaddr, Driver: a.Driver, Addr: a.Addr, Reg: a.Reg,
+		IntervalMs: a.IntervalMs, Deadband: a.Deadband,
+		HistSize: a.HistSize, HistRetentionSec: a.HistRetentionSec,
+	}
+}
+
+type tmptSig struct {
+	ID, Cmdlsb, Cmdmsb, Driver             string
+	Addr, Reg                              byte
+	Regaddr                                uint16
+	Regcount                               int
+	Deadband                               float64
+	IntervalMs, HistSize, HistRetentionSec int
+}
+
+func newTmptSig(t *btrd.Tmpt) tmptSig {
+	return tmptSig{
+		ID: t.ID, Cmdlsb: t.Cmdlsb, Cmdmsb: t.Cmdmsb, Regaddr: t.Regaddr,
+		Regcount: t.Regcount, Driver: t.Driver, Addr: t.Addr, Reg: t.Reg,
+		IntervalMs: t.IntervalMs, Deadband: t.Deadband,
+		HistSize: t.HistSize, HistRetentionSec: t.HistRetentionSec,
+	}
+}
+
+type swtSig struct {
+	ID, Cmdget, Cmdset, Cmdclr, Driver     string
+	Addr, Reg                              byte
+	Coiladdr                               uint16
+	IntervalMs, HistSize, HistRetentionSec int
+}
+
+func newSwtSig(sw *btrd.Swt) swtSig {
+	return swtSig{
+		ID: sw.ID, Cmdget: sw.Cmdget, Cmdset: sw.Cmdset, Cmdclr: sw.Cmdclr,
+		Coiladdr: sw.Coiladdr, Driver: sw.Driver, Addr: sw.Addr, Reg: sw.Reg,
+		IntervalMs: sw.IntervalMs,
+		HistSize:   sw.HistSize, HistRetentionSec: sw.HistRetentionSec,
+	}
+}
+
+// btdevSig mirrors the TOML-tagged config fields of a Btdev, with its
+// items reduced to their own signatures for the same back-reference
+// reason.
+type btdevSig struct {
+	ID, Devfile, TransportName string
+	Baud                       int
+	SlaveID                    byte
+	ADCs                       []adcSig
+	Tmpts                      []tmptSig
+	Swts                       []swtSig
+}
+
+// signature returns a string representation of btd's configuration, so
+// two Btdevs can be compared for a configuration change across a reload.
+func signature(btd *btrd.Btdev) string {
+	sig := btdevSig{
+		ID:            btd.ID,
+		Devfile:       btd.Devfile,
+		Baud:          btd.Baud,
+		TransportName: btd.TransportName,
+		SlaveID:       btd.SlaveID,
+	}
+	for _, a := range btd.ADCs {
+		sig.ADCs = append(sig.ADCs, newADCSig(a))
+	}
+	for _, t := range btd.Tmpts {
+		sig.Tmpts = append(sig.Tmpts, newTmptSig(t))
+	}
+	for _, sw := range btd.Swts {
+		sig.Swts = append(sig.Swts, newSwtSig(sw))
+	}
+	return fmt.Sprintf("%+v", sig)
+}
+
+// reloadConfig re-reads confile and diffs it against the running
+// devices: devices that are new or whose configuration changed get a
+// fresh polling goroutine, devices that were removed or changed are
+// stopped, and everything else keeps running undisturbed.
+func reloadConfig(confile string) {
+	b, err := ioutil.ReadFile(confile)
+	if err != nil {
+		log.Println("reload: read error:", err)
+		return
+	}
+	newConf := loadConfig(string(b))
+
+	devicesMu.Lock()
+	defer devicesMu.Unlock()
+
+	for id, old := range devices {
+		nw, ok := newConf[id]
+		if !ok || signature(old) != signature(nw) {
+			log.Printf("Stopping device <%s> for reload", id)
+			old.Stop()
+			delete(devices, id)
+		}
+	}
+	for id, nw := range newConf {
+		if _, ok := devices[id]; ok {
+			continue
+		}
+		nw.Init()
+		devices[id] = nw
+		go pollBtdev(nw)
+	}
+	log.Println("Config reloaded")
+}
+
+// watchReload triggers reloadConfig whenever the process receives
+// SIGHUP, so editing confile doesn't require a restart.
+func watchReload(confile string) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			log.Println("Received SIGHUP, reloading config")
+			reloadConfig(confile)
+		}
+	}()
+}
@@ -11,12 +11,12 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/vagabundor/btrd"
 )
 
 const failtimeout time.Duration = 30 * time.Second
 const maxerrors int = 3
-const errpause time.Duration = 4 * time.Second
 
 // LoadConfig method decodes config from toml
 func loadConfig(confstr string) map[string]*btrd.Btdev {
@@ -27,6 +27,8 @@ func loadConfig(confstr string) map[string]*btrd.Btdev {
 		log.Fatal(err)
 	}
 
+	delete(config, "mqtt")
+
 	for btk, btv := range config {
 		btv.ID = btk
 		switch {
@@ -34,6 +36,8 @@ func loadConfig(confstr string) map[string]*btrd.Btdev {
 			log.Fatalf("Baud rate of device <%s> is not defined \n", btk)
 		case btv.Devfile == "":
 			log.Fatalf("Device file of <%s> is not defined \n", btk)
+		case btv.TransportName == "modbus-rtu" && btv.SlaveID == 0:
+			log.Fatalf("Modbus slave_id of device <%s> is not defined \n", btk)
 		}
 
 		for _, adcv := range btv.ADCs {
@@ -43,7 +47,10 @@ func loadConfig(confstr string) map[string]*btrd.Btdev {
 				log.Fatalf("ID of adc in <%s> is not defined \n", btk)
 			case adcv.Cmdget == "":
 				log.Fatalf("Cmdget of adc <%s> in <%s> is not defined \n", adcv.ID, btk)
+			case adcv.Driver != "" && !btrd.IsI2CDevfile(btv.Devfile):
+				log.Fatalf("Driver of adc <%s> in <%s> requires an I2C devfile (/dev/i2c-*) \n", adcv.ID, btk)
 			}
+			adcv.Init()
 		}
 
 		for _, tmptv := range btv.Tmpts {
@@ -55,7 +62,10 @@ func loadConfig(confstr string) map[string]*btrd.Btdev {
 				log.Fatalf("Cmdlsb of tmpt <%s> in <%s> is not defined \n", tmptv.ID, btk)
 			case tmptv.Cmdmsb == "":
 				log.Fatalf("Cmdmsb of tmpt <%s> in <%s> is not defined \n", tmptv.ID, btk)
+			case tmptv.Driver != "" && !btrd.IsI2CDevfile(btv.Devfile):
+				log.Fatalf("Driver of tmpt <%s> in <%s> requires an I2C devfile (/dev/i2c-*) \n", tmptv.ID, btk)
 			}
+			tmptv.Init()
 		}
 
 		for _, swtv := range btv.Swts {
@@ -69,14 +79,30 @@ func loadConfig(confstr string) map[string]*btrd.Btdev {
 				log.Fatalf("Cmdset of swt <%s> in <%s> is not defined \n", swtv.ID, btk)
 			case swtv.Cmdclr == "":
 				log.Fatalf("Cmdclr of swt <%s> in <%s> is not defined \n", swtv.ID, btk)
+			case swtv.Driver != "" && !btrd.IsI2CDevfile(btv.Devfile):
+				log.Fatalf("Driver of swt <%s> in <%s> requires an I2C devfile (/dev/i2c-*) \n", swtv.ID, btk)
 			}
+			swtv.Init()
 		}
 	}
 	return config
 }
 
-func readHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, bt map[string]*btrd.Btdev) {
-	if btd, ok := bt[ps.ByName("btdevID")]; ok {
+// loadMQTTConfig decodes the optional [mqtt] section of confstr. It
+// returns nil if the section is absent, in which case the MQTT bridge is
+// not started.
+func loadMQTTConfig(confstr string) *MQTTConfig {
+	var wrapper struct {
+		MQTT *MQTTConfig `toml:"mqtt"`
+	}
+	if _, err := toml.Decode(confstr, &wrapper); err != nil {
+		log.Fatal(err)
+	}
+	return wrapper.MQTT
+}
+
+func readHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if btd, ok := getDevice(ps.ByName("btdevID")); ok {
 		switch ps.ByName("itemtypes") {
 		case "adcs":
 			for _, itv := range btd.ADCs {
@@ -110,8 +136,8 @@ func readHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, b
 	w.WriteHeader(400)
 }
 
-func changeHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, bt map[string]*btrd.Btdev) {
-	if btd, ok := bt[ps.ByName("btdevID")]; ok {
+func changeHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if btd, ok := getDevice(ps.ByName("btdevID")); ok {
 		if ps.ByName("itemtypes") == "swts" {
 			body, err := ioutil.ReadAll(r.Body)
 			if err != nil {
@@ -169,64 +195,51 @@ func main() {
 	if err != nil {
 		log.Fatal("error:", err)
 	}
-	bt := loadConfig(string(b))
+
+	devicesMu.Lock()
+	devices = loadConfig(string(b))
+	for _, btv := range devices {
+		btv.Init()
+	}
+	devicesMu.Unlock()
+
+	if mqttcfg := loadMQTTConfig(string(b)); mqttcfg != nil {
+		mqttBridgeInst = newMQTTBridge(mqttcfg)
+		if err := mqttBridgeInst.connect(); err != nil {
+			log.Println("mqtt: connect error:", err)
+		}
+	}
+
 	log.Println("API server launched")
-	for _, btv := range bt {
-		go func(bt *btrd.Btdev) {
-			log.Printf("Polling routine for device <%s> started..", bt.ID)
-			if err := bt.OpenPort(); err != nil {
-				log.Println(err)
-			}
-			defer bt.ClosePort()
-			var errcounter int
-			for {
-				for _, adc := range bt.ADCs {
-					if err := adc.ReadValue(); err != nil {
-						time.Sleep(errpause)
-						errcounter++
-					} else {
-						errcounter = 0
-					}
-				}
-				for _, tp := range bt.Tmpts {
-					if err := tp.ReadValue(); err != nil {
-						log.Println(err)
-						time.Sleep(errpause)
-						errcounter++
-					} else {
-						errcounter = 0
-					}
-				}
-				for _, sw := range bt.Swts {
-					if err := sw.ReadValue(); err != nil {
-						log.Println(err)
-						time.Sleep(errpause)
-						errcounter++
-					} else {
-						errcounter = 0
-					}
-				}
-				if errcounter > maxerrors {
-					bt.ClosePort()
-					log.Printf("Pause for %s %.0f seconds", bt.ID, failtimeout.Seconds())
-					time.Sleep(failtimeout)
-					if err := bt.OpenPort(); err != nil {
-						log.Println(err)
-					}
-					defer bt.ClosePort()
-					log.Printf("Port %s reopening.", bt.Devfile)
-					errcounter = 0
-				}
-			}
-		}(btv)
+	devicesMu.RLock()
+	for _, btv := range devices {
+		go pollBtdev(btv)
 	}
+	devicesMu.RUnlock()
+
+	watchReload(confile)
+
 	router := httprouter.New()
-	router.GET("/:btdevID/:itemtypes/:itemID", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		readHandler(w, r, ps, bt)
-	})
-	router.POST("/:btdevID/:itemtypes/:itemID", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		changeHandler(w, r, ps, bt)
+	router.GET("/:btdevID/:itemtypes/:itemID", readHandler)
+	router.GET("/:btdevID/:itemtypes/:itemID/history", historyHandler)
+	router.POST("/:btdevID/:itemtypes/:itemID", changeHandler)
+
+	// httprouter panics if a static route is registered as a sibling of
+	// the wildcard ":btdevID" at the same path segment, so top-level
+	// static routes like /metrics and /admin/reload can't live on router
+	// itself. Dispatch them from a plain http.ServeMux in front of it
+	// instead.
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/admin/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		reloadConfig(confile)
+		w.WriteHeader(http.StatusOK)
 	})
+	mux.Handle("/", router)
 	log.Println("Server listening on", bindaddr)
-	log.Fatal(http.ListenAndServe(bindaddr, router))
+	log.Fatal(http.ListenAndServe(bindaddr, mux))
 }
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vagabundor/btrd"
+)
+
+// maxBackoff caps how far a misbehaving item's poll interval is pushed
+// out by consecutive read failures.
+const maxBackoff = 2 * time.Minute
+
+// pollItem is one schedulable unit of work: read a single ADC/Tmpt/Swt
+// and report the result. Btdev.sermux (taken inside ReadValue) still
+// serializes access to the shared port, so items of the same Btdev never
+// read concurrently; the scheduler only changes the order and cadence in
+// which they're picked.
+type pollItem struct {
+	interval time.Duration
+	errs     int
+	due      time.Time
+	index    int
+	poll     func() error
+}
+
+// backoff returns interval after errs consecutive failures, doubling it
+// each time up to maxBackoff, so a single misbehaving item slows its own
+// polling instead of tripping a device-wide pause.
+func backoff(interval time.Duration, errs int) time.Duration {
+	d := interval
+	for i := 0; i < errs && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// itemQueue is a container/heap min-heap of pollItems ordered by due
+// time, one per Btdev, so its worker always pulls whichever item is due
+// next instead of polling every item at the slowest item's cadence.
+type itemQueue []*pollItem
+
+func (q itemQueue) Len() int           { return len(q) }
+func (q itemQueue) Less(i, j int) bool { return q[i].due.Before(q[j].due) }
+func (q itemQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+
+func (q *itemQueue) Push(x interface{}) {
+	it := x.(*pollItem)
+	it.index = len(*q)
+	*q = append(*q, it)
+}
+
+func (q *itemQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	it.index = -1
+	*q = old[:n-1]
+	return it
+}
+
+// buildQueue creates one pollItem per ADC/Tmpt/Swt of bt, each wired to
+// update Prometheus metrics and the MQTT bridge (subject to Deadband)
+// whenever its ReadValue succeeds.
+func buildQueue(bt *btrd.Btdev) itemQueue {
+	q := make(itemQueue, 0, len(bt.ADCs)+len(bt.Tmpts)+len(bt.Swts))
+	now := time.Now()
+
+	for _, adc := range bt.ADCs {
+		adc := adc
+		q = append(q, &pollItem{
+			interval: adc.Interval(),
+			due:      now,
+			poll: func() error {
+				if err := observeRead(bt.ID, "adc", adc.ID, adc.ReadValue); err != nil {
+					return err
+				}
+				if adc.ShouldNotify() {
+					adcValue.WithLabelValues(bt.ID, adc.ID).Set(adc.Value())
+					if mqttBridgeInst != nil {
+						mqttBridgeInst.publishState(bt.ID, "adcs", adc.ID, fmt.Sprintf("%.2f", adc.Value()))
+					}
+				}
+				return nil
+			},
+		})
+	}
+
+	for _, tp := range bt.Tmpts {
+		tp := tp
+		q = append(q, &pollItem{
+			interval: tp.Interval(),
+			due:      now,
+			poll: func() error {
+				if err := observeRead(bt.ID, "tmpt", tp.ID, tp.ReadValue); err != nil {
+					return err
+				}
+				if tp.ShouldNotify() {
+					temperatureCelsius.WithLabelValues(bt.ID, tp.ID).Set(tp.Value())
+					if mqttBridgeInst != nil {
+						mqttBridgeInst.publishState(bt.ID, "tmpts", tp.ID, fmt.Sprintf("%3.1f", tp.Value()))
+					}
+				}
+				return nil
+			},
+		})
+	}
+
+	for _, sw := range bt.Swts {
+		sw := sw
+		q = append(q, &pollItem{
+			interval: sw.Interval(),
+			due:      now,
+			poll: func() error {
+				if err := observeRead(bt.ID, "swt", sw.ID, sw.ReadValue); err != nil {
+					return err
+				}
+				switchState.WithLabelValues(bt.ID, sw.ID).Set(float64(sw.Value()))
+				return nil
+			},
+		})
+	}
+
+	heap.Init(&q)
+	return q
+}
+
+// pollBtdev opens bt's port and runs its per-item poll scheduler until
+// bt.Stop is called, at which point it closes the port and returns. It
+// is used both for the devices discovered at startup and for ones added
+// by a config reload.
+func pollBtdev(bt *btrd.Btdev) {
+	log.Printf("Polling routine for device <%s> started..", bt.ID)
+	if err := bt.OpenPort(); err != nil {
+		log.Println(err)
+	}
+	defer bt.ClosePort()
+
+	q := buildQueue(bt)
+	var lastReopen time.Time
+
+	for q.Len() > 0 {
+		item := q[0]
+		timer := time.NewTimer(time.Until(item.due))
+		select {
+		case <-bt.Done():
+			timer.Stop()
+			log.Printf("Polling routine for device <%s> stopped.", bt.ID)
+			return
+		case <-timer.C:
+		}
+
+		if err := item.poll(); err != nil {
+			log.Println(err)
+			item.errs++
+		} else {
+			item.errs = 0
+		}
+		item.due = time.Now().Add(backoff(item.interval, item.errs))
+		heap.Fix(&q, item.index)
+
+		if item.errs > maxerrors && time.Since(lastReopen) > failtimeout {
+			bt.ClosePort()
+			log.Printf("Pause for %s %.0f seconds", bt.ID, failtimeout.Seconds())
+			time.Sleep(failtimeout)
+			if err := bt.OpenPort(); err != nil {
+				log.Println(err)
+			}
+			serialReopensTotal.WithLabelValues(bt.ID).Inc()
+			log.Printf("Port %s reopening.", bt.Devfile)
+			lastReopen = time.Now()
+		}
+	}
+}
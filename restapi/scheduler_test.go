@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	interval := 500 * time.Millisecond
+	cases := []struct {
+		errs int
+		want time.Duration
+	}{
+		{0, interval},
+		{1, interval * 2},
+		{2, interval * 4},
+		{3, interval * 8},
+	}
+	for _, c := range cases {
+		if got := backoff(interval, c.errs); got != c.want {
+			t.Errorf("backoff(%v, %d) = %v, want %v", interval, c.errs, got, c.want)
+		}
+	}
+}
+
+func TestBackoffCapsAtMaxBackoff(t *testing.T) {
+	if got := backoff(time.Second, 20); got != maxBackoff {
+		t.Errorf("backoff(1s, 20) = %v, want the %v cap", got, maxBackoff)
+	}
+}
@@ -0,0 +1,287 @@
+package btrd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+// Modbus function codes used by ModbusRTU.
+const (
+	fcReadCoil             byte = 0x01
+	fcReadHoldingRegisters byte = 0x03
+	fcReadInputRegisters   byte = 0x04
+	fcWriteSingleCoil      byte = 0x05
+)
+
+// modbusResponseTimeout is the default time to wait for a Modbus RTU
+// slave to answer before giving up on a request.
+const modbusResponseTimeout time.Duration = 2 * time.Second
+
+// Names accepted by Btdev.TransportName in the TOML config.
+const (
+	transportRawSerial = ""
+	transportModbusRTU = "modbus-rtu"
+)
+
+// Transport is the wire protocol Btdev uses to talk to the remote device
+// over its serial line. RawSerial speaks the original single-byte
+// Cmdget/Cmdset protocol, ModbusRTU speaks Modbus RTU.
+type Transport interface {
+	Open(devfile string, baud int) error
+	Close()
+	// Raw writes cmd and reads back a single byte reply. It is the
+	// legacy ad-hoc protocol used by RawSerial.
+	Raw(cmd string) (byte, error)
+	// ReadRegister reads a single holding/input register (FC 0x03/0x04).
+	ReadRegister(slaveID byte, fc byte, addr uint16) (uint16, error)
+	// ReadCoil reads a single coil (FC 0x01).
+	ReadCoil(slaveID byte, addr uint16) (bool, error)
+	// WriteCoil writes a single coil (FC 0x05).
+	WriteCoil(slaveID byte, addr uint16, value bool) error
+}
+
+// RawSerial is the original Btdev transport: a single command byte is
+// written and a single byte reply is read back.
+type RawSerial struct {
+	port *serial.Port
+}
+
+// Open opens the serial port used by RawSerial.
+func (r *RawSerial) Open(devfile string, baud int) error {
+	c := &serial.Config{Name: devfile, Baud: baud, ReadTimeout: time.Second * 5}
+	port, err := serial.OpenPort(c)
+	if err != nil {
+		return err
+	}
+	r.port = port
+	return nil
+}
+
+// Close closes the serial port used by RawSerial.
+func (r *RawSerial) Close() {
+	r.port.Close()
+}
+
+// Raw writes cmd and returns the single byte reply.
+func (r *RawSerial) Raw(cmd string) (byte, error) {
+	if _, err := r.port.Write([]byte(cmd)); err != nil {
+		return 0, fmt.Errorf("RawSerial write error: %s", err)
+	}
+	res := make([]byte, 1)
+	if _, err := r.port.Read(res); err != nil {
+		return 0, fmt.Errorf("RawSerial read error: %s", err)
+	}
+	return res[0], nil
+}
+
+// ReadRegister is not supported by RawSerial.
+func (r *RawSerial) ReadRegister(slaveID byte, fc byte, addr uint16) (uint16, error) {
+	return 0, fmt.Errorf("RawSerial: Modbus registers are not supported")
+}
+
+// ReadCoil is not supported by RawSerial.
+func (r *RawSerial) ReadCoil(slaveID byte, addr uint16) (bool, error) {
+	return false, fmt.Errorf("RawSerial: Modbus coils are not supported")
+}
+
+// WriteCoil is not supported by RawSerial.
+func (r *RawSerial) WriteCoil(slaveID byte, addr uint16, value bool) error {
+	return fmt.Errorf("RawSerial: Modbus coils are not supported")
+}
+
+// ModbusRTU is a Transport that speaks Modbus RTU over the serial line.
+type ModbusRTU struct {
+	port    *serial.Port
+	baud    int
+	Timeout time.Duration
+}
+
+// Open opens the serial port used by ModbusRTU.
+func (m *ModbusRTU) Open(devfile string, baud int) error {
+	timeout := m.Timeout
+	if timeout == 0 {
+		timeout = modbusResponseTimeout
+	}
+	c := &serial.Config{Name: devfile, Baud: baud, ReadTimeout: timeout}
+	port, err := serial.OpenPort(c)
+	if err != nil {
+		return err
+	}
+	m.port = port
+	m.baud = baud
+	m.Timeout = timeout
+	return nil
+}
+
+// Close closes the serial port used by ModbusRTU.
+func (m *ModbusRTU) Close() {
+	m.port.Close()
+}
+
+// Raw is not supported by ModbusRTU.
+func (m *ModbusRTU) Raw(cmd string) (byte, error) {
+	return 0, fmt.Errorf("ModbusRTU: raw commands are not supported")
+}
+
+// crc16Modbus computes the Modbus CRC-16 (polynomial 0xA001) of data.
+func crc16Modbus(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = (crc >> 1) ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// interFrameDelay returns the 3.5 character silence required between
+// Modbus RTU frames at the transport's configured baud rate.
+func (m *ModbusRTU) interFrameDelay() time.Duration {
+	charTime := time.Second * 11 / time.Duration(m.baud)
+	delay := charTime * 35 / 10
+	if delay < 1750*time.Microsecond {
+		delay = 1750 * time.Microsecond
+	}
+	return delay
+}
+
+// request builds a Modbus RTU ADU for the given slave, function code and
+// 16-bit address/data fields, with the CRC-16 appended little-endian.
+func request(slaveID byte, fc byte, addr uint16, data uint16) []byte {
+	adu := make([]byte, 6, 8)
+	adu[0] = slaveID
+	adu[1] = fc
+	binary.BigEndian.PutUint16(adu[2:4], addr)
+	binary.BigEndian.PutUint16(adu[4:6], data)
+	crc := crc16Modbus(adu)
+	return append(adu, byte(crc), byte(crc>>8))
+}
+
+// responseLen returns the expected total length of a Modbus RTU response
+// to fc, given the bytes of it read so far. It returns 0 if resp isn't
+// long enough yet to know: an exception response is always 5 bytes
+// (address, function|0x80, exception code, 2 CRC bytes), a coil write
+// response echoes the fixed 8-byte request, and a read response's length
+// depends on its byte-count field, resp[2].
+func responseLen(resp []byte, fc byte) int {
+	if len(resp) < 2 {
+		return 0
+	}
+	if resp[1]&0x80 != 0 {
+		return 5
+	}
+	if fc == fcWriteSingleCoil {
+		return 8
+	}
+	if len(resp) < 3 {
+		return 0
+	}
+	return 3 + int(resp[2]) + 2
+}
+
+// readResponse reads a Modbus RTU response to fc. tarm/serial opens the
+// port with VMIN=0, so a single Read can return as soon as one byte has
+// arrived, well before the rest of the frame is on the wire; this
+// accumulates reads into resp until responseLen recognizes a complete
+// frame, the line falls silent for longer than the inter-frame delay
+// (taken as end of a shorter-than-expected frame, left for the caller's
+// length/CRC checks to reject), or the overall response timeout elapses
+// with nothing recognizable at all.
+func (m *ModbusRTU) readResponse(fc byte) ([]byte, error) {
+	resp := make([]byte, 0, 16)
+	buf := make([]byte, 16)
+	idle := m.interFrameDelay()
+	start := time.Now()
+	for {
+		if want := responseLen(resp, fc); want > 0 && len(resp) >= want {
+			return resp[:want], nil
+		}
+		n, err := m.port.Read(buf)
+		if err != nil {
+			return nil, fmt.Errorf("ModbusRTU read error: %s", err)
+		}
+		if n > 0 {
+			resp = append(resp, buf[:n]...)
+			start = time.Now()
+			continue
+		}
+		if len(resp) > 0 && time.Since(start) > idle {
+			return resp, nil
+		}
+		if time.Since(start) > m.Timeout {
+			return nil, fmt.Errorf("ModbusRTU: timed out waiting for response, got %d of %d bytes", len(resp), responseLen(resp, fc))
+		}
+	}
+}
+
+// do waits out the inter-frame silence, sends req, and reads back a
+// response for the given function code, validating its CRC.
+func (m *ModbusRTU) do(req []byte, fc byte) ([]byte, error) {
+	time.Sleep(m.interFrameDelay())
+	if _, err := m.port.Write(req); err != nil {
+		return nil, fmt.Errorf("ModbusRTU write error: %s", err)
+	}
+	resp, err := m.readResponse(fc)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 5 {
+		return nil, fmt.Errorf("ModbusRTU: short response from slave %d", req[0])
+	}
+	if resp[1]&0x80 != 0 {
+		return nil, fmt.Errorf("ModbusRTU: exception response from slave %d, code 0x%02x", resp[0], resp[2])
+	}
+	if resp[1] != fc {
+		return nil, fmt.Errorf("ModbusRTU: unexpected function code 0x%02x from slave %d", resp[1], resp[0])
+	}
+	gotCRC := crc16Modbus(resp[:len(resp)-2])
+	wantCRC := uint16(resp[len(resp)-2]) | uint16(resp[len(resp)-1])<<8
+	if gotCRC != wantCRC {
+		return nil, fmt.Errorf("ModbusRTU: CRC mismatch from slave %d", resp[0])
+	}
+	return resp, nil
+}
+
+// ReadRegister reads a single holding or input register with fc
+// fcReadHoldingRegisters or fcReadInputRegisters.
+func (m *ModbusRTU) ReadRegister(slaveID byte, fc byte, addr uint16) (uint16, error) {
+	resp, err := m.do(request(slaveID, fc, addr, 1), fc)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) < 5 || resp[2] < 2 {
+		return 0, fmt.Errorf("ModbusRTU: short register payload from slave %d", slaveID)
+	}
+	return binary.BigEndian.Uint16(resp[3:5]), nil
+}
+
+// ReadCoil reads a single coil with fcReadCoil.
+func (m *ModbusRTU) ReadCoil(slaveID byte, addr uint16) (bool, error) {
+	resp, err := m.do(request(slaveID, fcReadCoil, addr, 1), fcReadCoil)
+	if err != nil {
+		return false, err
+	}
+	if len(resp) < 4 {
+		return false, fmt.Errorf("ModbusRTU: short coil payload from slave %d", slaveID)
+	}
+	return resp[3]&0x01 != 0, nil
+}
+
+// WriteCoil writes a single coil with fcWriteSingleCoil. Modbus encodes
+// coil-on as 0xFF00 and coil-off as 0x0000.
+func (m *ModbusRTU) WriteCoil(slaveID byte, addr uint16, value bool) error {
+	data := uint16(0x0000)
+	if value {
+		data = 0xFF00
+	}
+	_, err := m.do(request(slaveID, fcWriteSingleCoil, addr, data), fcWriteSingleCoil)
+	return err
+}
@@ -0,0 +1,67 @@
+package btrd
+
+import "testing"
+
+func TestCRC16Modbus(t *testing.T) {
+	// 01 03 00 00 00 01, CRC 84 0A (little-endian on the wire), a
+	// standard reference frame for reading holding register 0 of slave 1.
+	data := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01}
+	got := crc16Modbus(data)
+	if want := uint16(0x0A84); got != want {
+		t.Errorf("crc16Modbus(%x) = %#04x, want %#04x", data, got, want)
+	}
+}
+
+func TestCRC16ModbusRoundTrip(t *testing.T) {
+	adu := request(0x11, fcReadHoldingRegisters, 0x006B, 3)
+	crc := crc16Modbus(adu[:len(adu)-2])
+	gotLo, gotHi := byte(crc), byte(crc>>8)
+	if wantLo, wantHi := adu[len(adu)-2], adu[len(adu)-1]; gotLo != wantLo || gotHi != wantHi {
+		t.Errorf("request() CRC bytes = %02x %02x, want %02x %02x", gotLo, gotHi, wantLo, wantHi)
+	}
+}
+
+func TestInterFrameDelay(t *testing.T) {
+	cases := []struct {
+		baud int
+		min  bool // true if the 1750us floor should apply
+	}{
+		{baud: 9600, min: false},
+		{baud: 115200, min: true},
+	}
+	for _, c := range cases {
+		m := &ModbusRTU{baud: c.baud}
+		got := m.interFrameDelay()
+		if c.min {
+			if got != 1750_000 {
+				t.Errorf("interFrameDelay(baud=%d) = %v, want the 1750us floor", c.baud, got)
+			}
+			continue
+		}
+		if got <= 1750_000 {
+			t.Errorf("interFrameDelay(baud=%d) = %v, want more than the 1750us floor", c.baud, got)
+		}
+	}
+}
+
+func TestResponseLen(t *testing.T) {
+	cases := []struct {
+		name string
+		resp []byte
+		fc   byte
+		want int
+	}{
+		{"too short", []byte{0x01}, fcReadHoldingRegisters, 0},
+		{"exception", []byte{0x01, fcReadHoldingRegisters | 0x80}, fcReadHoldingRegisters, 5},
+		{"write coil", []byte{0x01, fcWriteSingleCoil}, fcWriteSingleCoil, 8},
+		{"read holding registers, byte count known", []byte{0x01, fcReadHoldingRegisters, 0x02}, fcReadHoldingRegisters, 7},
+		{"read holding registers, byte count unknown yet", []byte{0x01, fcReadHoldingRegisters}, fcReadHoldingRegisters, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := responseLen(c.resp, c.fc); got != c.want {
+				t.Errorf("responseLen(%x, %#02x) = %d, want %d", c.resp, c.fc, got, c.want)
+			}
+		})
+	}
+}